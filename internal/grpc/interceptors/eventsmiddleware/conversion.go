@@ -19,7 +19,9 @@
 package eventsmiddleware
 
 import (
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/events"
 )
 
@@ -35,3 +37,39 @@ func ShareCreated(r *collaboration.CreateShareResponse) events.ShareCreated {
 
 	return e
 }
+
+// GrantAdded converts request to event.
+func GrantAdded(executant *user.UserId, itemID *provider.ResourceId, r *provider.AddGrantRequest) events.GrantAdded {
+	return events.GrantAdded{
+		Executant:      executant,
+		Ref:            r.Ref,
+		ItemID:         itemID,
+		GranteeUserID:  r.Grant.GetGrantee().GetUserId(),
+		GranteeGroupID: r.Grant.GetGrantee().GetGroupId(),
+		Permissions:    r.Grant.GetPermissions(),
+	}
+}
+
+// GrantUpdated converts request to event.
+func GrantUpdated(executant *user.UserId, itemID *provider.ResourceId, r *provider.UpdateGrantRequest) events.GrantUpdated {
+	return events.GrantUpdated{
+		Executant:      executant,
+		Ref:            r.Ref,
+		ItemID:         itemID,
+		GranteeUserID:  r.Grant.GetGrantee().GetUserId(),
+		GranteeGroupID: r.Grant.GetGrantee().GetGroupId(),
+		Permissions:    r.Grant.GetPermissions(),
+	}
+}
+
+// GrantRemoved converts request to event.
+func GrantRemoved(executant *user.UserId, itemID *provider.ResourceId, r *provider.RemoveGrantRequest) events.GrantRemoved {
+	return events.GrantRemoved{
+		Executant:      executant,
+		Ref:            r.Ref,
+		ItemID:         itemID,
+		GranteeUserID:  r.Grant.GetGrantee().GetUserId(),
+		GranteeGroupID: r.Grant.GetGrantee().GetGroupId(),
+		Permissions:    r.Grant.GetPermissions(),
+	}
+}
@@ -23,10 +23,18 @@ import (
 	"fmt"
 
 	"github.com/asim/go-micro/plugins/events/nats/v4"
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/events"
 	"github.com/cs3org/reva/pkg/events/server"
 	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/utils/cfg"
 	"go-micro.dev/v4/util/log"
 	"google.golang.org/grpc"
 )
@@ -39,28 +47,72 @@ func init() {
 	rgrpc.RegisterUnaryInterceptor("eventsmiddleware", NewUnary)
 }
 
+type config struct {
+	Type        string `docs:";The type of the events stream, only nats is supported."                                                      mapstructure:"type"`
+	Address     string `docs:";The address of the nats server."                                                                             mapstructure:"address"`
+	ClusterID   string `docs:";The cluster id of the nats server."                                                                          mapstructure:"clusterID"`
+	GatewayAddr string `docs:";The gateway used to resolve the resource id of path based grant references. Defaults to the shared gateway." mapstructure:"gateway_addr"`
+}
+
+func (c *config) ApplyDefaults() {
+	c.GatewayAddr = sharedconf.GetGatewaySVC(c.GatewayAddr)
+}
+
 // NewUnary returns a new unary interceptor that emits events when needed
 // no lint because of the switch statement that should be extendable
 //
 
 func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error) {
-	publisher, err := publisherFromConfig(m)
+	var c config
+	if err := cfg.Decode(m, &c); err != nil {
+		return nil, 0, err
+	}
+
+	publisher, err := publisherFromConfig(&c)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	return newUnary(publisher, gatewayStat(c.GatewayAddr)), defaultPriority, nil
+}
+
+// statFunc resolves a reference to the id of the resource it points to.
+type statFunc func(ctx context.Context, ref *provider.Reference) (*provider.ResourceId, error)
+
+// newUnary returns the interceptor publishing the events to the publisher.
+// Grant events carry the id of the affected resource: for path based
+// references it is resolved with stat, which costs an extra, blocking
+// round trip to the gateway after every successful grant change.
+// Nothing is published if publisher is nil.
+func newUnary(publisher events.Publisher, stat statFunc) grpc.UnaryServerInterceptor {
 	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		res, err := handler(ctx, req)
-		if err != nil {
+		if err != nil || publisher == nil {
 			return res, err
 		}
 
+		var executant *user.UserId
+		if u, ok := appctx.ContextGetUser(ctx); ok {
+			executant = u.Id
+		}
+
 		var ev interface{}
 
-		// gocritic is disabled because the use of .(type) outside type switch is forbidden
-		switch v := res.(type) { //nolint:gocritic
+		switch v := res.(type) {
 		case *collaboration.CreateShareResponse:
 			ev = ShareCreated(v)
+		case *provider.AddGrantResponse:
+			if r, ok := req.(*provider.AddGrantRequest); ok && isSuccess(v.Status) {
+				ev = GrantAdded(executant, resolveItemID(ctx, stat, r.Ref), r)
+			}
+		case *provider.UpdateGrantResponse:
+			if r, ok := req.(*provider.UpdateGrantRequest); ok && isSuccess(v.Status) {
+				ev = GrantUpdated(executant, resolveItemID(ctx, stat, r.Ref), r)
+			}
+		case *provider.RemoveGrantResponse:
+			if r, ok := req.(*provider.RemoveGrantRequest); ok && isSuccess(v.Status) {
+				ev = GrantRemoved(executant, resolveItemID(ctx, stat, r.Ref), r)
+			}
 		}
 
 		if ev != nil {
@@ -71,7 +123,45 @@ func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error
 
 		return res, nil
 	}
-	return interceptor, defaultPriority, nil
+	return interceptor
+}
+
+func isSuccess(s *rpc.Status) bool {
+	return s.GetCode() == rpc.Code_CODE_OK
+}
+
+// resolveItemID returns the id of the resource the reference points to,
+// falling back to a stat when the reference is (partly) path based.
+func resolveItemID(ctx context.Context, stat statFunc, ref *provider.Reference) *provider.ResourceId {
+	if id := ref.GetResourceId(); id != nil && (ref.GetPath() == "" || ref.GetPath() == ".") {
+		return id
+	}
+	if stat == nil {
+		return nil
+	}
+	id, err := stat(ctx, ref)
+	if err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Interface("ref", ref).Msg("eventsmiddleware: error resolving resource id")
+		return nil
+	}
+	return id
+}
+
+func gatewayStat(gatewayAddr string) statFunc {
+	return func(ctx context.Context, ref *provider.Reference) (*provider.ResourceId, error) {
+		client, err := pool.GetGatewayServiceClient(pool.Endpoint(gatewayAddr))
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+		if err != nil {
+			return nil, err
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return nil, errtypes.InternalError(res.Status.Message)
+		}
+		return res.Info.Id, nil
+	}
 }
 
 // NewStream returns a new server stream interceptor
@@ -84,14 +174,11 @@ func NewStream() grpc.StreamServerInterceptor {
 	return interceptor
 }
 
-func publisherFromConfig(m map[string]interface{}) (events.Publisher, error) {
-	typ := m["type"].(string)
-	switch typ {
+func publisherFromConfig(c *config) (events.Publisher, error) {
+	switch c.Type {
 	default:
-		return nil, fmt.Errorf("stream type '%s' not supported", typ)
+		return nil, fmt.Errorf("stream type '%s' not supported", c.Type)
 	case "nats":
-		address := m["address"].(string)
-		cid := m["clusterID"].(string)
-		return server.NewNatsStream(nats.Address(address), nats.ClusterID(cid))
+		return server.NewNatsStream(nats.Address(c.Address), nats.ClusterID(c.ClusterID))
 	}
 }
@@ -0,0 +1,182 @@
+// Copyright 2018-2023 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package eventsmiddleware
+
+import (
+	"context"
+	"testing"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/utils"
+	microevents "go-micro.dev/v4/events"
+	"google.golang.org/grpc"
+)
+
+type recordingPublisher struct {
+	events []interface{}
+}
+
+func (p *recordingPublisher) Publish(_ string, ev interface{}, _ ...microevents.PublishOption) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func TestGrantEvents(t *testing.T) {
+	executant := &user.UserId{Idp: "idp", OpaqueId: "einstein"}
+	grantee := &user.UserId{Idp: "idp", OpaqueId: "marie"}
+	itemID := &provider.ResourceId{StorageId: "storageId", OpaqueId: "opaqueId"}
+	ref := &provider.Reference{ResourceId: itemID}
+	statID := &provider.ResourceId{StorageId: "storageId", OpaqueId: "statted"}
+	pathRef := &provider.Reference{Path: "/home/shared"}
+	stat := func(_ context.Context, r *provider.Reference) (*provider.ResourceId, error) {
+		if r != pathRef {
+			t.Errorf("unexpected stat of %v", r)
+		}
+		return statID, nil
+	}
+	grant := &provider.Grant{
+		Grantee: &provider.Grantee{
+			Type: provider.GranteeType_GRANTEE_TYPE_USER,
+			Id:   &provider.Grantee_UserId{UserId: grantee},
+		},
+		Permissions: &provider.ResourcePermissions{Stat: true, InitiateFileDownload: true},
+	}
+	ok := &rpc.Status{Code: rpc.Code_CODE_OK}
+
+	ctx := appctx.ContextSetUser(context.Background(), &user.User{Id: executant})
+
+	tests := []struct {
+		name string
+		req  interface{}
+		res  interface{}
+		// nil if no event is expected
+		check func(t *testing.T, ev interface{})
+	}{
+		{
+			name: "add grant",
+			req:  &provider.AddGrantRequest{Ref: ref, Grant: grant},
+			res:  &provider.AddGrantResponse{Status: ok},
+			check: func(t *testing.T, ev interface{}) {
+				e, ok := ev.(events.GrantAdded)
+				if !ok {
+					t.Fatalf("expected GrantAdded event, got %T", ev)
+				}
+				if e.GranteeUserID != grantee || e.Executant != executant || !utils.ResourceIDEqual(e.ItemID, itemID) || !e.Permissions.Stat {
+					t.Errorf("unexpected event %+v", e)
+				}
+			},
+		},
+		{
+			name: "update grant",
+			req:  &provider.UpdateGrantRequest{Ref: ref, Grant: grant},
+			res:  &provider.UpdateGrantResponse{Status: ok},
+			check: func(t *testing.T, ev interface{}) {
+				e, ok := ev.(events.GrantUpdated)
+				if !ok {
+					t.Fatalf("expected GrantUpdated event, got %T", ev)
+				}
+				if e.GranteeUserID != grantee || e.Executant != executant || !utils.ResourceIDEqual(e.ItemID, itemID) {
+					t.Errorf("unexpected event %+v", e)
+				}
+			},
+		},
+		{
+			name: "remove grant",
+			req:  &provider.RemoveGrantRequest{Ref: ref, Grant: grant},
+			res:  &provider.RemoveGrantResponse{Status: ok},
+			check: func(t *testing.T, ev interface{}) {
+				e, ok := ev.(events.GrantRemoved)
+				if !ok {
+					t.Fatalf("expected GrantRemoved event, got %T", ev)
+				}
+				if e.GranteeUserID != grantee || e.GranteeGroupID != nil || e.Executant != executant || !utils.ResourceIDEqual(e.ItemID, itemID) {
+					t.Errorf("unexpected event %+v", e)
+				}
+			},
+		},
+		{
+			name: "add grant by path",
+			req:  &provider.AddGrantRequest{Ref: pathRef, Grant: grant},
+			res:  &provider.AddGrantResponse{Status: ok},
+			check: func(t *testing.T, ev interface{}) {
+				e, ok := ev.(events.GrantAdded)
+				if !ok {
+					t.Fatalf("expected GrantAdded event, got %T", ev)
+				}
+				if !utils.ResourceIDEqual(e.ItemID, statID) {
+					t.Errorf("expected item id %v, got %v", statID, e.ItemID)
+				}
+			},
+		},
+		{
+			name: "failed add grant",
+			req:  &provider.AddGrantRequest{Ref: ref, Grant: grant},
+			res:  &provider.AddGrantResponse{Status: &rpc.Status{Code: rpc.Code_CODE_PERMISSION_DENIED}},
+		},
+		{
+			name: "unrelated response",
+			req:  &provider.StatRequest{Ref: ref},
+			res:  &provider.StatResponse{Status: ok},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &recordingPublisher{}
+			interceptor := newUnary(p, stat)
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return tt.res, nil
+			}
+			if _, err := interceptor(ctx, tt.req, &grpc.UnaryServerInfo{}, handler); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.check == nil {
+				if len(p.events) != 0 {
+					t.Fatalf("expected no events, got %v", p.events)
+				}
+				return
+			}
+			if len(p.events) != 1 {
+				t.Fatalf("expected exactly one event, got %v", p.events)
+			}
+			tt.check(t, p.events[0])
+		})
+	}
+}
+
+func TestNilPublisher(t *testing.T) {
+	interceptor := newUnary(nil, nil)
+	req := &provider.AddGrantRequest{Ref: &provider.Reference{Path: "/home/shared"}, Grant: &provider.Grant{}}
+	res := &provider.AddGrantResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return res, nil
+	}
+	got, err := interceptor(context.Background(), req, &grpc.UnaryServerInfo{}, handler)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != res {
+		t.Errorf("expected the handler response to be passed through, got %v", got)
+	}
+}
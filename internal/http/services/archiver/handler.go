@@ -41,6 +41,7 @@ import (
 	"github.com/cs3org/reva/pkg/sharedconf"
 	"github.com/cs3org/reva/pkg/storage/utils/downloader"
 	"github.com/cs3org/reva/pkg/storage/utils/walker"
+	"github.com/cs3org/reva/pkg/utils"
 	"github.com/cs3org/reva/pkg/utils/cfg"
 	"github.com/cs3org/reva/pkg/utils/resourceid"
 	"github.com/gdexlab/go-render/render"
@@ -256,7 +257,7 @@ func (s *svc) Handler() http.Handler {
 
 		log.Debug().Msg("Requested the following files/folders to archive: " + render.Render(files))
 
-		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", archName))
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", utils.SanitizeFilename(archName)))
 		rw.Header().Set("Content-Transfer-Encoding", "binary")
 
 		// create the archive
@@ -33,6 +33,7 @@ import (
 	"github.com/cs3org/reva/pkg/httpclient"
 	"github.com/cs3org/reva/pkg/rhttp/router"
 	"github.com/cs3org/reva/pkg/storage/utils/downloader"
+	"github.com/cs3org/reva/pkg/utils"
 	"github.com/cs3org/reva/pkg/utils/resourceid"
 )
 
@@ -242,7 +243,7 @@ func (h *VersionsHandler) doDownload(w http.ResponseWriter, r *http.Request, s *
 		return
 	}
 
-	fname := filepath.Base(resStat.Info.Path)
+	fname := utils.SanitizeFilename(filepath.Base(resStat.Info.Path))
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fname))
 	w.Header().Set("Content-Transfer-Encoding", "binary")
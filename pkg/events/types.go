@@ -44,3 +44,57 @@ func (ShareCreated) Unmarshal(v []byte) (interface{}, error) {
 	err := json.Unmarshal(v, &e)
 	return e, err
 }
+
+// GrantAdded is emitted when a grant is added to a resource.
+type GrantAdded struct {
+	Executant *user.UserId
+	Ref       *provider.Reference
+	ItemID    *provider.ResourceId
+	// split the protobuf Grantee oneof so we can use stdlib encoding/json
+	GranteeUserID  *user.UserId
+	GranteeGroupID *group.GroupId
+	Permissions    *provider.ResourcePermissions
+}
+
+// Unmarshal to fulfill umarshaller interface.
+func (GrantAdded) Unmarshal(v []byte) (interface{}, error) {
+	e := GrantAdded{}
+	err := json.Unmarshal(v, &e)
+	return e, err
+}
+
+// GrantUpdated is emitted when the permissions of a grant are updated.
+type GrantUpdated struct {
+	Executant *user.UserId
+	Ref       *provider.Reference
+	ItemID    *provider.ResourceId
+	// split the protobuf Grantee oneof so we can use stdlib encoding/json
+	GranteeUserID  *user.UserId
+	GranteeGroupID *group.GroupId
+	Permissions    *provider.ResourcePermissions
+}
+
+// Unmarshal to fulfill umarshaller interface.
+func (GrantUpdated) Unmarshal(v []byte) (interface{}, error) {
+	e := GrantUpdated{}
+	err := json.Unmarshal(v, &e)
+	return e, err
+}
+
+// GrantRemoved is emitted when a grant is removed from a resource.
+type GrantRemoved struct {
+	Executant *user.UserId
+	Ref       *provider.Reference
+	ItemID    *provider.ResourceId
+	// split the protobuf Grantee oneof so we can use stdlib encoding/json
+	GranteeUserID  *user.UserId
+	GranteeGroupID *group.GroupId
+	Permissions    *provider.ResourcePermissions
+}
+
+// Unmarshal to fulfill umarshaller interface.
+func (GrantRemoved) Unmarshal(v []byte) (interface{}, error) {
+	e := GrantRemoved{}
+	err := json.Unmarshal(v, &e)
+	return e, err
+}
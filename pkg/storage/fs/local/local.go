@@ -32,8 +32,9 @@ func init() {
 }
 
 type config struct {
-	Root        string `docs:"/var/tmp/reva/;Path of root directory for user storage." mapstructure:"root"`
-	ShareFolder string `docs:"/MyShares;Path for storing share references."            mapstructure:"share_folder"`
+	Root        string `docs:"/var/tmp/reva/;Path of root directory for user storage."                                                 mapstructure:"root"`
+	ShareFolder string `docs:"/MyShares;Path for storing share references."                                                            mapstructure:"share_folder"`
+	Uploads     string `docs:"/var/tmp/reva/.uploads;Path for storing in-progress uploads, may be on a different filesystem than root" mapstructure:"uploads"`
 }
 
 func (c *config) ApplyDefaults() {
@@ -56,6 +57,7 @@ func New(ctx context.Context, m map[string]interface{}) (storage.FS, error) {
 	conf := localfs.Config{
 		Root:        c.Root,
 		ShareFolder: c.ShareFolder,
+		Uploads:     c.Uploads,
 		DisableHome: true,
 	}
 	return localfs.NewLocalFS(&conf)
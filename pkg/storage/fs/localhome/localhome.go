@@ -33,9 +33,11 @@ func init() {
 }
 
 type config struct {
-	Root        string `docs:"/var/tmp/reva/;Path of root directory for user storage." mapstructure:"root"`
-	ShareFolder string `docs:"/MyShares;Path for storing share references."            mapstructure:"share_folder"`
-	UserLayout  string `docs:"{{.Username}};Template for user home directories"        mapstructure:"user_layout"`
+	Root        string            `docs:"/var/tmp/reva/;Path of root directory for user storage."                                                 mapstructure:"root"`
+	ShareFolder string            `docs:"/MyShares;Path for storing share references."                                                            mapstructure:"share_folder"`
+	UserLayout  string            `docs:"{{.Username}};Template for user home directories"                                                        mapstructure:"user_layout"`
+	UserLayouts map[string]string `docs:"nil;Templates for user home directories by user type, falling back to user_layout"                       mapstructure:"user_layouts"`
+	Uploads     string            `docs:"/var/tmp/reva/.uploads;Path for storing in-progress uploads, may be on a different filesystem than root" mapstructure:"uploads"`
 }
 
 func (c *config) ApplyDefaults() {
@@ -70,7 +72,9 @@ func New(ctx context.Context, m map[string]interface{}) (storage.FS, error) {
 	conf := localfs.Config{
 		Root:        c.Root,
 		ShareFolder: c.ShareFolder,
+		Uploads:     c.Uploads,
 		UserLayout:  c.UserLayout,
+		UserLayouts: c.UserLayouts,
 	}
 	return localfs.NewLocalFS(&conf)
 }
@@ -22,6 +22,7 @@ import (
 	"context"
 	"database/sql"
 	"path"
+	"strings"
 
 	// Provides sqlite drivers.
 	_ "github.com/mattn/go-sqlite3"
@@ -163,6 +164,44 @@ func (fs *localfs) removeFromFavoritesDB(ctx context.Context, resource, grantee
 	return nil
 }
 
+func (fs *localfs) isFavorite(ctx context.Context, resource, grantee string) (bool, error) {
+	var favorite int
+	err := fs.db.QueryRow("SELECT favorite FROM user_interaction WHERE resource=? AND grantee=?", resource, grantee).Scan(&favorite)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return favorite == 1, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// getFavoritesInDir returns the resources directly below dir that the grantee
+// marked as favorite.
+func (fs *localfs) getFavoritesInDir(ctx context.Context, dir, grantee string) (map[string]struct{}, error) {
+	prefix := likeEscaper.Replace(strings.TrimSuffix(dir, "/")) + "/%"
+	rows, err := fs.db.Query(`SELECT resource FROM user_interaction WHERE grantee=? AND favorite=1 AND resource LIKE ? ESCAPE '\'`, grantee, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := make(map[string]struct{})
+	for rows.Next() {
+		var resource string
+		if err := rows.Scan(&resource); err != nil {
+			return nil, err
+		}
+		if path.Dir(resource) == path.Clean(dir) {
+			favorites[resource] = struct{}{}
+		}
+	}
+	return favorites, rows.Err()
+}
+
 func (fs *localfs) addToMetadataDB(ctx context.Context, resource, key, value string) error {
 	stmt, err := fs.db.Prepare("INSERT INTO metadata (resource, key, value) VALUES (?, ?, ?) ON CONFLICT(resource, key) DO UPDATE SET value=?")
 	if err != nil {
@@ -48,19 +48,22 @@ import (
 	"github.com/pkg/errors"
 )
 
+const favoritesKey = "http://owncloud.org/ns/favorite"
+
 // Config holds the configuration details for the local fs.
 type Config struct {
-	Root                string `mapstructure:"root"`
-	DisableHome         bool   `mapstructure:"disable_home"`
-	UserLayout          string `mapstructure:"user_layout"`
-	ShareFolder         string `mapstructure:"share_folder"`
-	DataTransfersFolder string `mapstructure:"data_transfers_folder"`
-	Uploads             string `mapstructure:"uploads"`
-	DataDirectory       string `mapstructure:"data_directory"`
-	RecycleBin          string `mapstructure:"recycle_bin"`
-	Versions            string `mapstructure:"versions"`
-	Shadow              string `mapstructure:"shadow"`
-	References          string `mapstructure:"references"`
+	Root                string            `mapstructure:"root"`
+	DisableHome         bool              `mapstructure:"disable_home"`
+	UserLayout          string            `mapstructure:"user_layout"`
+	UserLayouts         map[string]string `mapstructure:"user_layouts"`
+	ShareFolder         string            `mapstructure:"share_folder"`
+	DataTransfersFolder string            `mapstructure:"data_transfers_folder"`
+	Uploads             string            `mapstructure:"uploads"`
+	DataDirectory       string            `mapstructure:"data_directory"`
+	RecycleBin          string            `mapstructure:"recycle_bin"`
+	Versions            string            `mapstructure:"versions"`
+	Shadow              string            `mapstructure:"shadow"`
+	References          string            `mapstructure:"references"`
 }
 
 func (c *Config) ApplyDefaults() {
@@ -84,7 +87,9 @@ func (c *Config) ApplyDefaults() {
 	c.ShareFolder = path.Join("/", c.ShareFolder)
 
 	c.DataDirectory = path.Join(c.Root, "data")
-	c.Uploads = path.Join(c.Root, ".uploads")
+	if c.Uploads == "" {
+		c.Uploads = path.Join(c.Root, ".uploads")
+	}
 	c.Shadow = path.Join(c.Root, ".shadow")
 
 	c.References = path.Join(c.Shadow, "references")
@@ -330,13 +335,16 @@ func (fs *localfs) permissionSet(ctx context.Context, owner *userpb.UserId) *pro
 	}
 }
 
-func (fs *localfs) normalize(ctx context.Context, fi os.FileInfo, fn string, mdKeys []string) (*provider.ResourceInfo, error) {
+// normalize converts the file info into a resource info. favorites holds the
+// favorites of the current user among the siblings of fn, if already known;
+// when nil they are looked up for fn alone.
+func (fs *localfs) normalize(ctx context.Context, fi os.FileInfo, fn string, mdKeys []string, favorites map[string]struct{}) (*provider.ResourceInfo, error) {
 	fp := fs.unwrap(ctx, path.Join("/", fn))
 	owner, err := getUser(ctx)
 	if err != nil {
 		return nil, err
 	}
-	metadata, err := fs.retrieveArbitraryMetadata(ctx, fn, mdKeys)
+	metadata, err := fs.retrieveArbitraryMetadata(ctx, fn, mdKeys, favorites)
 	if err != nil {
 		return nil, err
 	}
@@ -368,8 +376,8 @@ func (fs *localfs) normalize(ctx context.Context, fi os.FileInfo, fn string, mdK
 	return md, nil
 }
 
-func (fs *localfs) convertToFileReference(ctx context.Context, fi os.FileInfo, fn string, mdKeys []string) (*provider.ResourceInfo, error) {
-	info, err := fs.normalize(ctx, fi, fn, mdKeys)
+func (fs *localfs) convertToFileReference(ctx context.Context, fi os.FileInfo, fn string, mdKeys []string, favorites map[string]struct{}) (*provider.ResourceInfo, error) {
+	info, err := fs.normalize(ctx, fi, fn, mdKeys, favorites)
 	if err != nil {
 		return nil, err
 	}
@@ -389,7 +397,7 @@ func getResourceType(isDir bool) provider.ResourceType {
 	return provider.ResourceType_RESOURCE_TYPE_FILE
 }
 
-func (fs *localfs) retrieveArbitraryMetadata(ctx context.Context, fn string, mdKeys []string) (*provider.ArbitraryMetadata, error) {
+func (fs *localfs) retrieveArbitraryMetadata(ctx context.Context, fn string, mdKeys []string, favorites map[string]struct{}) (*provider.ArbitraryMetadata, error) {
 	md, err := fs.getMetadata(ctx, fn)
 	if err != nil {
 		return nil, errors.Wrap(err, "localfs: error listing metadata")
@@ -402,25 +410,78 @@ func (fs *localfs) retrieveArbitraryMetadata(ctx context.Context, fn string, mdK
 		mdKeysMap[k] = struct{}{}
 	}
 
-	var returnAllKeys bool
-	if _, ok := mdKeysMap["*"]; len(mdKeys) == 0 || ok {
-		returnAllKeys = true
-	}
+	returnAllKeys := returnAllMetadataKeys(mdKeys)
 
 	for md.Next() {
 		err = md.Scan(&mdKey, &mdVal)
 		if err != nil {
 			return nil, errors.Wrap(err, "localfs: error scanning db rows")
 		}
+		// favorites used to be stored in the shared metadata table,
+		// such rows are not per user and must not be returned
+		if mdKey == favoritesKey {
+			continue
+		}
 		if _, ok := mdKeysMap[mdKey]; returnAllKeys || ok {
 			metadata[mdKey] = mdVal
 		}
 	}
+
+	// favorites are stored per user, so only the ones of the current user are returned
+	if _, ok := mdKeysMap[favoritesKey]; returnAllKeys || ok {
+		var favorite bool
+		if favorites != nil {
+			_, favorite = favorites[fn]
+		} else {
+			usr, err := favoritesGrantee(ctx)
+			if err != nil {
+				return nil, err
+			}
+			favorite, err = fs.isFavorite(ctx, fn, usr)
+			if err != nil {
+				return nil, errors.Wrap(err, "localfs: error reading favorite from DB")
+			}
+		}
+		if favorite {
+			metadata[favoritesKey] = "1"
+		}
+	}
+
 	return &provider.ArbitraryMetadata{
 		Metadata: metadata,
 	}, nil
 }
 
+func returnAllMetadataKeys(mdKeys []string) bool {
+	return len(mdKeys) == 0 || requestsMetadataKey(mdKeys, "*")
+}
+
+func requestsMetadataKey(mdKeys []string, key string) bool {
+	for _, k := range mdKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// listFavorites returns the favorites of the current user among the
+// children of dir, or nil if favorites were not requested.
+func (fs *localfs) listFavorites(ctx context.Context, dir string, mdKeys []string) (map[string]struct{}, error) {
+	if !returnAllMetadataKeys(mdKeys) && !requestsMetadataKey(mdKeys, favoritesKey) {
+		return nil, nil
+	}
+	usr, err := favoritesGrantee(ctx)
+	if err != nil {
+		return nil, err
+	}
+	favorites, err := fs.getFavoritesInDir(ctx, dir, usr)
+	if err != nil {
+		return nil, errors.Wrap(err, "localfs: error reading favorites from DB")
+	}
+	return favorites, nil
+}
+
 // GetPathByID returns the path pointed by the file id
 // In this implementation the file id is in the form `fileid-url_encoded_path`.
 func (fs *localfs) GetPathByID(ctx context.Context, ref *provider.ResourceId) (string, error) {
@@ -616,20 +677,24 @@ func (fs *localfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Refer
 			delete(md.Metadata, "etag")
 		}
 
-		if _, ok := md.Metadata["favorite"]; ok {
-			u, err := getUser(ctx)
-			if err != nil {
-				return err
-			}
-			if uid := u.GetId(); uid != nil {
-				usr := fmt.Sprintf("u:%s@%s", uid.GetOpaqueId(), uid.GetIdp())
-				if err = fs.addToFavoritesDB(ctx, np, usr); err != nil {
+		for _, k := range []string{"favorite", favoritesKey} {
+			if v, ok := md.Metadata[k]; ok {
+				usr, err := favoritesGrantee(ctx)
+				if err != nil {
+					return err
+				}
+				if isFalsy(v) {
+					if err = fs.removeFromFavoritesDB(ctx, np, usr); err != nil {
+						return errors.Wrap(err, "localfs: error removing entry from DB")
+					}
+				} else if err = fs.addToFavoritesDB(ctx, np, usr); err != nil {
 					return errors.Wrap(err, "localfs: error adding entry to DB")
 				}
-			} else {
-				return errors.Wrap(errtypes.UserRequired("userrequired"), "user has no id")
+				if err = fs.removeFromMetadataDB(ctx, np, favoritesKey); err != nil {
+					return errors.Wrap(err, "localfs: error removing legacy favorite from DB")
+				}
+				delete(md.Metadata, k)
 			}
-			delete(md.Metadata, "favorite")
 		}
 	}
 
@@ -643,6 +708,30 @@ func (fs *localfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Refer
 	return fs.propagate(ctx, np)
 }
 
+// favoritesGrantee returns the grantee under which the favorites
+// of the user in the context are stored.
+func favoritesGrantee(ctx context.Context) (string, error) {
+	u, err := getUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	uid := u.GetId()
+	if uid == nil {
+		return "", errors.Wrap(errtypes.UserRequired("userrequired"), "user has no id")
+	}
+	return fmt.Sprintf("u:%s@%s", uid.GetOpaqueId(), uid.GetIdp()), nil
+}
+
+// isFalsy reports whether a metadata value such as "", "0" or "false"
+// switches a flag off.
+func isFalsy(v string) bool {
+	if v == "" {
+		return true
+	}
+	b, err := strconv.ParseBool(v)
+	return err == nil && !b
+}
+
 func parseMTime(v string) (t time.Time, err error) {
 	p := strings.SplitN(v, ".", 2)
 	var sec, nsec int64
@@ -680,18 +769,16 @@ func (fs *localfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Ref
 
 	for _, k := range keys {
 		switch k {
-		case "favorite":
-			u, err := getUser(ctx)
+		case "favorite", favoritesKey:
+			usr, err := favoritesGrantee(ctx)
 			if err != nil {
 				return err
 			}
-			if uid := u.GetId(); uid != nil {
-				usr := fmt.Sprintf("u:%s@%s", uid.GetOpaqueId(), uid.GetIdp())
-				if err = fs.removeFromFavoritesDB(ctx, np, usr); err != nil {
-					return errors.Wrap(err, "localfs: error removing entry from DB")
-				}
-			} else {
-				return errors.Wrap(errtypes.UserRequired("userrequired"), "user has no id")
+			if err = fs.removeFromFavoritesDB(ctx, np, usr); err != nil {
+				return errors.Wrap(err, "localfs: error removing entry from DB")
+			}
+			if err = fs.removeFromMetadataDB(ctx, np, favoritesKey); err != nil {
+				return errors.Wrap(err, "localfs: error removing legacy favorite from DB")
 			}
 		case "etag":
 			return errors.Wrap(errtypes.NotSupported("unsetting etag not supported"), "could not unset metadata")
@@ -738,11 +825,20 @@ func (fs *localfs) GetHome(ctx context.Context) (string, error) {
 		err = errors.Wrap(err, "local: wrap: no user in ctx and home is enabled")
 		return "", err
 	}
-	relativeHome := templates.WithUser(u, fs.conf.UserLayout)
+	relativeHome := templates.WithUser(u, fs.userLayout(u))
 
 	return relativeHome, nil
 }
 
+// userLayout returns the layout configured for the type of the given user,
+// falling back to the default user layout.
+func (fs *localfs) userLayout(u *userpb.User) string {
+	if layout, ok := fs.conf.UserLayouts[utils.UserTypeToString(u.Id.GetType())]; ok {
+		return layout
+	}
+	return fs.conf.UserLayout
+}
+
 func (fs *localfs) CreateHome(ctx context.Context) error {
 	if fs.conf.DisableHome {
 		return errtypes.NotSupported("localfs: create home not supported")
@@ -932,7 +1028,7 @@ func (fs *localfs) GetMD(ctx context.Context, ref *provider.Reference, mdKeys []
 		return nil, errors.Wrap(err, "localfs: error stating "+fn)
 	}
 
-	return fs.normalize(ctx, md, fn, mdKeys)
+	return fs.normalize(ctx, md, fn, mdKeys, nil)
 }
 
 func (fs *localfs) getMDShareFolder(ctx context.Context, p string, mdKeys []string) (*provider.ResourceInfo, error) {
@@ -946,9 +1042,9 @@ func (fs *localfs) getMDShareFolder(ctx context.Context, p string, mdKeys []stri
 	}
 
 	if fs.isShareFolderRoot(ctx, p) {
-		return fs.normalize(ctx, md, fn, mdKeys)
+		return fs.normalize(ctx, md, fn, mdKeys, nil)
 	}
-	return fs.convertToFileReference(ctx, md, fn, mdKeys)
+	return fs.convertToFileReference(ctx, md, fn, mdKeys, nil)
 }
 
 func (fs *localfs) ListFolder(ctx context.Context, ref *provider.Reference, mdKeys []string) ([]*provider.ResourceInfo, error) {
@@ -1003,9 +1099,14 @@ func (fs *localfs) listFolder(ctx context.Context, fn string, mdKeys []string) (
 		mds = append(mds, info)
 	}
 
+	favorites, err := fs.listFavorites(ctx, fn, mdKeys)
+	if err != nil {
+		return nil, err
+	}
+
 	finfos := []*provider.ResourceInfo{}
 	for _, md := range mds {
-		info, err := fs.normalize(ctx, md, path.Join(fn, md.Name()), mdKeys)
+		info, err := fs.normalize(ctx, md, path.Join(fn, md.Name()), mdKeys, favorites)
 		if err == nil {
 			finfos = append(finfos, info)
 		}
@@ -1032,14 +1133,19 @@ func (fs *localfs) listShareFolderRoot(ctx context.Context, home string, mdKeys
 		mds = append(mds, info)
 	}
 
+	favorites, err := fs.listFavorites(ctx, fn, mdKeys)
+	if err != nil {
+		return nil, err
+	}
+
 	finfos := []*provider.ResourceInfo{}
 	for _, md := range mds {
 		var info *provider.ResourceInfo
 		var err error
 		if fs.isShareFolderRoot(ctx, path.Join("/", md.Name())) {
-			info, err = fs.normalize(ctx, md, path.Join(fn, md.Name()), mdKeys)
+			info, err = fs.normalize(ctx, md, path.Join(fn, md.Name()), mdKeys, favorites)
 		} else {
-			info, err = fs.convertToFileReference(ctx, md, path.Join(fn, md.Name()), mdKeys)
+			info, err = fs.convertToFileReference(ctx, md, path.Join(fn, md.Name()), mdKeys, favorites)
 		}
 		if err == nil {
 			finfos = append(finfos, info)
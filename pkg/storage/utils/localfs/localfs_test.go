@@ -0,0 +1,389 @@
+// Copyright 2018-2023 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package localfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+)
+
+func TestGetHomeUserLayouts(t *testing.T) {
+	fs, err := NewLocalFS(&Config{
+		Root:       t.TempDir(),
+		UserLayout: "{{.Username}}",
+		UserLayouts: map[string]string{
+			"guest": "guests/{{.Username}}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating localfs: %v", err)
+	}
+	t.Cleanup(func() { _ = fs.Shutdown(context.Background()) })
+
+	tests := []struct {
+		name     string
+		user     *userpb.User
+		expected string
+	}{
+		{
+			name: "primary user",
+			user: &userpb.User{
+				Id:       &userpb.UserId{OpaqueId: "einstein", Type: userpb.UserType_USER_TYPE_PRIMARY},
+				Username: "einstein",
+			},
+			expected: "einstein",
+		},
+		{
+			name: "guest user",
+			user: &userpb.User{
+				Id:       &userpb.UserId{OpaqueId: "marie", Type: userpb.UserType_USER_TYPE_GUEST},
+				Username: "marie",
+			},
+			expected: "guests/marie",
+		},
+		{
+			name: "type without specific layout",
+			user: &userpb.User{
+				Id:       &userpb.UserId{OpaqueId: "richard", Type: userpb.UserType_USER_TYPE_LIGHTWEIGHT},
+				Username: "richard",
+			},
+			expected: "richard",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := appctx.ContextSetUser(context.Background(), tt.user)
+			home, err := fs.GetHome(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if home != tt.expected {
+				t.Errorf("expected home %s, got %s", tt.expected, home)
+			}
+		})
+	}
+}
+
+func TestFavoritesPerUser(t *testing.T) {
+	fs, err := NewLocalFS(&Config{
+		Root:        t.TempDir(),
+		DisableHome: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating localfs: %v", err)
+	}
+	t.Cleanup(func() { _ = fs.Shutdown(context.Background()) })
+
+	einstein := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "einstein"},
+		Username: "einstein",
+	})
+	marie := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "marie"},
+		Username: "marie",
+	})
+
+	ref := &provider.Reference{Path: "/folder"}
+	if err := fs.CreateDir(einstein, ref); err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+
+	isFavorite := func(ctx context.Context, mdKeys []string) bool {
+		md, err := fs.GetMD(ctx, ref, mdKeys)
+		if err != nil {
+			t.Fatalf("error getting md: %v", err)
+		}
+		_, ok := md.GetArbitraryMetadata().GetMetadata()[favoritesKey]
+		return ok
+	}
+
+	if err := fs.SetArbitraryMetadata(einstein, ref, &provider.ArbitraryMetadata{
+		Metadata: map[string]string{favoritesKey: "1"},
+	}); err != nil {
+		t.Fatalf("error setting favorite: %v", err)
+	}
+
+	if !isFavorite(einstein, nil) || !isFavorite(einstein, []string{favoritesKey}) {
+		t.Errorf("expected folder to be a favorite for einstein")
+	}
+	if isFavorite(einstein, []string{"other"}) {
+		t.Errorf("expected favorite to be omitted when not requested")
+	}
+	if isFavorite(marie, nil) {
+		t.Errorf("expected folder not to be a favorite for marie")
+	}
+
+	if err := fs.UnsetArbitraryMetadata(einstein, ref, []string{favoritesKey}); err != nil {
+		t.Fatalf("error unsetting favorite: %v", err)
+	}
+	if isFavorite(einstein, nil) {
+		t.Errorf("expected folder not to be a favorite for einstein after unsetting")
+	}
+
+	for _, v := range []string{"1", "0", "true", "false", ""} {
+		if err := fs.SetArbitraryMetadata(einstein, ref, &provider.ArbitraryMetadata{
+			Metadata: map[string]string{"favorite": v},
+		}); err != nil {
+			t.Fatalf("error setting favorite to %q: %v", v, err)
+		}
+		expected := v == "1" || v == "true"
+		if isFavorite(einstein, nil) != expected {
+			t.Errorf("expected favorite to be %t after setting it to %q", expected, v)
+		}
+	}
+}
+
+func TestListFolderFavorites(t *testing.T) {
+	fs, err := NewLocalFS(&Config{
+		Root:        t.TempDir(),
+		DisableHome: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating localfs: %v", err)
+	}
+	t.Cleanup(func() { _ = fs.Shutdown(context.Background()) })
+
+	ctx := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "einstein"},
+		Username: "einstein",
+	})
+
+	for _, p := range []string{"/dir", "/dir/fav_1", "/dir/other", "/dir/fav_1/nested", "/dir_2"} {
+		if err := fs.CreateDir(ctx, &provider.Reference{Path: p}); err != nil {
+			t.Fatalf("error creating dir %s: %v", p, err)
+		}
+	}
+	for _, p := range []string{"/dir/fav_1", "/dir/fav_1/nested", "/dir_2"} {
+		if err := fs.SetArbitraryMetadata(ctx, &provider.Reference{Path: p}, &provider.ArbitraryMetadata{
+			Metadata: map[string]string{favoritesKey: "1"},
+		}); err != nil {
+			t.Fatalf("error setting favorite on %s: %v", p, err)
+		}
+	}
+
+	for _, mdKeys := range [][]string{nil, {favoritesKey}} {
+		infos, err := fs.ListFolder(ctx, &provider.Reference{Path: "/dir"}, mdKeys)
+		if err != nil {
+			t.Fatalf("error listing folder: %v", err)
+		}
+		if len(infos) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(infos))
+		}
+		for _, info := range infos {
+			_, favorite := info.GetArbitraryMetadata().GetMetadata()[favoritesKey]
+			if expected := info.Path == "/dir/fav_1"; favorite != expected {
+				t.Errorf("expected favorite of %s to be %t with keys %v", info.Path, expected, mdKeys)
+			}
+		}
+	}
+}
+
+func TestCustomUploadsDir(t *testing.T) {
+	root, uploads := t.TempDir(), filepath.Join(t.TempDir(), "scratch")
+	fs, err := NewLocalFS(&Config{
+		Root:        root,
+		DisableHome: true,
+		Uploads:     uploads,
+	})
+	if err != nil {
+		t.Fatalf("error creating localfs: %v", err)
+	}
+	t.Cleanup(func() { _ = fs.Shutdown(context.Background()) })
+
+	ctx := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "einstein"},
+		Username: "einstein",
+	})
+
+	ids, err := fs.InitiateUpload(ctx, &provider.Reference{Path: "/file.txt"}, 10, nil)
+	if err != nil {
+		t.Fatalf("error initiating upload: %v", err)
+	}
+
+	for _, p := range []string{ids["simple"], ids["simple"] + ".info"} {
+		if _, err := os.Stat(filepath.Join(uploads, p)); err != nil {
+			t.Errorf("expected upload session file %s in the uploads dir: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".uploads", ids["simple"])); !os.IsNotExist(err) {
+		t.Errorf("expected no upload session in the default uploads dir, got %v", err)
+	}
+
+	content := "0123456789"
+	if err := fs.Upload(ctx, &provider.Reference{Path: ids["simple"]}, io.NopCloser(strings.NewReader(content))); err != nil {
+		t.Fatalf("error uploading: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "data", "file.txt"))
+	if err != nil {
+		t.Fatalf("error reading uploaded file: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("expected content %q, got %q", content, data)
+	}
+	for _, p := range []string{ids["simple"], ids["simple"] + ".info"} {
+		if _, err := os.Stat(filepath.Join(uploads, p)); !os.IsNotExist(err) {
+			t.Errorf("expected upload session file %s to be removed, got %v", p, err)
+		}
+	}
+}
+
+func TestCopyAndRemove(t *testing.T) {
+	src, dir := filepath.Join(t.TempDir(), "upload"), t.TempDir()
+	dst := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(src, []byte("content"), 0600); err != nil {
+		t.Fatalf("error writing source: %v", err)
+	}
+	if err := os.WriteFile(dst, []byte("old"), 0600); err != nil {
+		t.Fatalf("error writing destination: %v", err)
+	}
+
+	if err := copyAndRemove(context.Background(), src, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("error reading destination: %v", err)
+	}
+	if string(data) != "content" {
+		t.Errorf("expected destination to be overwritten, got %q", data)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("expected source to be removed, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error reading dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no leftover temporary files, got %v", entries)
+	}
+}
+
+func TestRecycleOriginPath(t *testing.T) {
+	fs, err := NewLocalFS(&Config{
+		Root:        t.TempDir(),
+		DisableHome: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating localfs: %v", err)
+	}
+	t.Cleanup(func() { _ = fs.Shutdown(context.Background()) })
+
+	ctx := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "einstein"},
+		Username: "einstein",
+	})
+
+	for _, p := range []string{"/a", "/a/b", "/a/b/c"} {
+		if err := fs.CreateDir(ctx, &provider.Reference{Path: p}); err != nil {
+			t.Fatalf("error creating dir %s: %v", p, err)
+		}
+	}
+	if err := fs.Delete(ctx, &provider.Reference{Path: "/a/b/c"}); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+
+	items, err := fs.ListRecycle(ctx, "/", "", "")
+	if err != nil {
+		t.Fatalf("error listing recycle: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected one recycle item, got %d", len(items))
+	}
+	if items[0].Ref.GetPath() != "/a/b/c" {
+		t.Errorf("expected origin path /a/b/c, got %s", items[0].Ref.GetPath())
+	}
+
+	if err := fs.RestoreRecycleItem(ctx, "/", items[0].Key, "", nil); err != nil {
+		t.Fatalf("error restoring: %v", err)
+	}
+	if _, err := fs.GetMD(ctx, &provider.Reference{Path: "/a/b/c"}, nil); err != nil {
+		t.Errorf("expected item to be restored to its origin path: %v", err)
+	}
+}
+
+func TestLegacySharedFavorite(t *testing.T) {
+	fs, err := NewLocalFS(&Config{
+		Root:        t.TempDir(),
+		DisableHome: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating localfs: %v", err)
+	}
+	t.Cleanup(func() { _ = fs.Shutdown(context.Background()) })
+	lfs := fs.(*localfs)
+
+	einstein := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "einstein"},
+		Username: "einstein",
+	})
+	marie := appctx.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "idp", OpaqueId: "marie"},
+		Username: "marie",
+	})
+
+	ref := &provider.Reference{Path: "/folder"}
+	if err := fs.CreateDir(einstein, ref); err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	// favorites used to be stored in the shared metadata table
+	np := lfs.wrap(einstein, "/folder")
+	if err := lfs.addToMetadataDB(einstein, np, favoritesKey, "1"); err != nil {
+		t.Fatalf("error seeding legacy favorite: %v", err)
+	}
+
+	for _, ctx := range []context.Context{einstein, marie} {
+		md, err := fs.GetMD(ctx, ref, nil)
+		if err != nil {
+			t.Fatalf("error getting md: %v", err)
+		}
+		if v, ok := md.GetArbitraryMetadata().GetMetadata()[favoritesKey]; ok {
+			t.Errorf("expected legacy favorite not to be returned, got %q", v)
+		}
+	}
+
+	if err := fs.UnsetArbitraryMetadata(einstein, ref, []string{favoritesKey}); err != nil {
+		t.Fatalf("error unsetting favorite: %v", err)
+	}
+	rows, err := lfs.getMetadata(einstein, np)
+	if err != nil {
+		t.Fatalf("error reading metadata: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			t.Fatalf("error scanning metadata: %v", err)
+		}
+		if k == favoritesKey {
+			t.Errorf("expected legacy favorite row to be removed, got %q", v)
+		}
+	}
+}
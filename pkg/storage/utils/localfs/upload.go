@@ -24,6 +24,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
@@ -325,7 +326,7 @@ func (upload *fileUpload) FinishUpload(ctx context.Context) error {
 		}
 	}
 
-	err := os.Rename(upload.binPath, np)
+	err := moveFile(ctx, upload.binPath, np)
 	if err != nil {
 		return err
 	}
@@ -344,6 +345,60 @@ func (upload *fileUpload) FinishUpload(ctx context.Context) error {
 	return err
 }
 
+// moveFile renames src to dst. When the uploads directory lives on a
+// different filesystem than the data directory the rename fails with EXDEV,
+// in which case the file is copied next to dst, renamed into place and the
+// source is removed.
+func moveFile(ctx context.Context, src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	return copyAndRemove(ctx, src, dst)
+}
+
+func copyAndRemove(ctx context.Context, src, dst string) error {
+	log := appctx.GetLogger(ctx)
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "localfs: error creating temporary file")
+	}
+	if err := copyToTemp(tmp, in, dst); err != nil {
+		if rerr := os.Remove(tmp.Name()); rerr != nil && !os.IsNotExist(rerr) {
+			log.Error().Err(rerr).Str("path", tmp.Name()).Msg("localfs: could not remove temporary file")
+		}
+		return err
+	}
+
+	// the file is in place, a leftover upload file must not fail the upload
+	if err := os.Remove(src); err != nil {
+		log.Error().Err(err).Str("path", src).Msg("localfs: could not remove upload file")
+	}
+	return nil
+}
+
+// copyToTemp copies the content of in to tmp, closes it and renames it to dst.
+func copyToTemp(tmp *os.File, in io.Reader, dst string) error {
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "localfs: error copying upload")
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), defaultFilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
 // To implement the termination extension as specified in https://tus.io/protocols/resumable-upload.html#termination
 // - the storage needs to implement AsTerminatableUpload
 // - the upload needs to implement Terminate
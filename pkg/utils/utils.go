@@ -19,7 +19,10 @@
 package utils
 
 import (
+	"crypto/md5"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -30,6 +33,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
@@ -37,6 +42,7 @@ import (
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/registry"
 	"github.com/cs3org/reva/pkg/registry/memory"
 	"go.step.sm/crypto/randutil"
@@ -49,7 +55,7 @@ import (
 var (
 	matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
 	matchAllCap   = regexp.MustCompile("([a-z0-9])([A-Z])")
-	matchEmail    = regexp.MustCompile(`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`)
+	matchEmail    = regexp.MustCompile(`^[\w+-]+(\.[\w+-]+)*@([\w-]+\.)+[a-zA-Z]{2,}$`)
 	// GlobalRegistry configures a service registry globally accessible. It defaults to a memory registry. The usage of
 	// globals is not encouraged, and this is a workaround until the PR is out of a draft state.
 	GlobalRegistry registry.Registry = memory.New(map[string]interface{}{})
@@ -77,6 +83,44 @@ func Skip(source string, prefixes []string) bool {
 	return false
 }
 
+// SkipFold is like Skip, but the prefixes are matched case-insensitively.
+// i.e: /A/b/C/d contains prefix /a/B/c.
+func SkipFold(source string, prefixes []string) bool {
+	source = appendSlash(source)
+	for _, prefix := range prefixes {
+		prefix = appendSlash(prefix)
+		if len(source) >= len(prefix) && strings.EqualFold(source[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnySuffix evaluates whether source ends with any of the suffixes.
+// Empty suffixes are ignored.
+// i.e: /a/b/file.txt has suffix .txt.
+func HasAnySuffix(source string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if suffix != "" && strings.HasSuffix(source, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildEtag returns a quoted md5 etag computed from the given parts,
+// in the same 34 characters format used by the storage drivers.
+// The result depends on the order of the parts, and the parts are
+// length-prefixed so that i.e. ("ab", "c") and ("a", "bc") differ.
+func BuildEtag(parts ...string) string {
+	h := md5.New()
+	for _, p := range parts {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(p)))
+		_, _ = io.WriteString(h, p)
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil))
+}
+
 // GetClientIP retrieves the client IP from incoming requests.
 func GetClientIP(r *http.Request) (string, error) {
 	var clientIP string
@@ -177,6 +221,29 @@ func ResourceIDEqual(u, v *provider.ResourceId) bool {
 	return u != nil && v != nil && u.StorageId == v.StorageId && u.OpaqueId == v.OpaqueId
 }
 
+// ContainsResourceID returns whether ids contains a resource id equal to id.
+func ContainsResourceID(ids []*provider.ResourceId, id *provider.ResourceId) bool {
+	for _, i := range ids {
+		if ResourceIDEqual(i, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// DedupResourceIDs returns the resource ids in ids without duplicates,
+// preserving the order in which they are first seen. Nil entries are dropped.
+func DedupResourceIDs(ids []*provider.ResourceId) []*provider.ResourceId {
+	res := make([]*provider.ResourceId, 0, len(ids))
+	for _, id := range ids {
+		if id == nil || ContainsResourceID(res, id) {
+			continue
+		}
+		res = append(res, id)
+	}
+	return res
+}
+
 // ResourceEqual returns whether two resources have the same field values.
 func ResourceEqual(u, v *provider.Reference) bool {
 	return u != nil && v != nil && u.Path == v.Path && ((u.ResourceId == nil && v.ResourceId == nil) || (ResourceIDEqual(u.ResourceId, v.ResourceId)))
@@ -200,6 +267,29 @@ func IsEmailValid(e string) bool {
 	return matchEmail.MatchString(e)
 }
 
+// SanitizeFilename returns a version of name that can safely be used as a
+// quoted filename in a Content-Disposition header (RFC 6266).
+// Control characters are removed, quotes, backslashes and slashes are replaced
+// with underscores, while any other unicode character is preserved.
+// If nothing is left, "download" is returned.
+func SanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError || unicode.IsControl(r):
+			return -1
+		case r == '"' || r == '\\' || r == '/':
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "download"
+	}
+	return name
+}
+
 // IsValidWebAddress checks whether the provided address is a valid URL.
 func IsValidWebAddress(address string) bool {
 	_, err := url.ParseRequestURI(address)
@@ -261,6 +351,38 @@ func IsAbsolutePathReference(ref *provider.Reference) bool {
 	return ref.ResourceId == nil && strings.HasPrefix(ref.Path, "/")
 }
 
+// ReferenceKind describes how a reference addresses a resource.
+type ReferenceKind int
+
+const (
+	// ReferenceKindInvalid is a reference which is neither relative nor absolute.
+	ReferenceKindInvalid ReferenceKind = iota
+	// ReferenceKindRelative is a reference with a resource id and a path relative to it.
+	ReferenceKindRelative
+	// ReferenceKindAbsoluteID is a reference with only a resource id.
+	ReferenceKindAbsoluteID
+	// ReferenceKindAbsolutePath is a reference with only a global path.
+	ReferenceKindAbsolutePath
+)
+
+// GetReferenceKind returns the kind of the given reference.
+// It follows IsRelativeReference, IsAbsoluteReference and IsAbsolutePathReference,
+// so a resource id with empty storage and opaque ids still counts as set.
+func GetReferenceKind(ref *provider.Reference) ReferenceKind {
+	switch {
+	case ref == nil:
+		return ReferenceKindInvalid
+	case IsRelativeReference(ref):
+		return ReferenceKindRelative
+	case IsAbsolutePathReference(ref):
+		return ReferenceKindAbsolutePath
+	case IsAbsoluteReference(ref):
+		return ReferenceKindAbsoluteID
+	default:
+		return ReferenceKindInvalid
+	}
+}
+
 // MakeRelativePath prefixes the path with a . to use it in a relative reference.
 func MakeRelativePath(p string) string {
 	p = path.Join("/", p)
@@ -271,6 +393,80 @@ func MakeRelativePath(p string) string {
 	return "." + p
 }
 
+// CleanPath returns the cleaned, absolute form of p.
+// Unlike a plain path.Join("/", p), it returns an error if p contains
+// ".." elements that would escape the root after cleaning.
+// i.e: a/../b is cleaned to /b, while a/../../b is rejected.
+func CleanPath(p string) (string, error) {
+	rel := path.Clean(strings.TrimLeft(p, "/"))
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errtypes.BadRequest("path escapes the root: " + p)
+	}
+	return path.Join("/", rel), nil
+}
+
+// PathReference returns an absolute path reference for the given path.
+// The path is cleaned with CleanPath and always starts with a /.
+// It returns nil if the path is empty or escapes the root.
+func PathReference(p string) *provider.Reference {
+	if p == "" {
+		return nil
+	}
+	cleaned, err := CleanPath(p)
+	if err != nil {
+		return nil
+	}
+	return &provider.Reference{Path: cleaned}
+}
+
+// RelativePathReference returns a reference relative to the given resource id,
+// with the path cleaned with CleanPath and built using MakeRelativePath.
+// It returns nil if the resource id is nil, the path is empty or escapes the root.
+func RelativePathReference(id *provider.ResourceId, p string) *provider.Reference {
+	if id == nil || p == "" {
+		return nil
+	}
+	cleaned, err := CleanPath(p)
+	if err != nil {
+		return nil
+	}
+	return &provider.Reference{ResourceId: id, Path: MakeRelativePath(cleaned)}
+}
+
+// RelativePathBetween returns the path of descendant relative to ancestor,
+// i.e: "b/c" for /a and /a/b/c, or "." if they point to the same resource.
+// Both references must either be global path references or be relative to
+// the same resource id, and descendant must be below ancestor. Paths are
+// cleaned with CleanPath, so paths escaping the root are rejected.
+func RelativePathBetween(ancestor, descendant *provider.Reference) (string, error) {
+	if ancestor == nil || descendant == nil {
+		return "", errtypes.BadRequest("references must not be nil")
+	}
+	if (ancestor.ResourceId == nil) != (descendant.ResourceId == nil) ||
+		(ancestor.ResourceId != nil && !ResourceIDEqual(ancestor.ResourceId, descendant.ResourceId)) {
+		return "", errtypes.BadRequest("references do not share the same root")
+	}
+
+	a, err := CleanPath(ancestor.Path)
+	if err != nil {
+		return "", err
+	}
+	d, err := CleanPath(descendant.Path)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case a == d:
+		return ".", nil
+	case a == "/":
+		return d[1:], nil
+	case strings.HasPrefix(d, a+"/"):
+		return d[len(a)+1:], nil
+	default:
+		return "", errtypes.BadRequest(d + " is not below " + a)
+	}
+}
+
 // UserTypeMap translates account type string to CS3 UserType.
 func UserTypeMap(accountType string) userpb.UserType {
 	var t userpb.UserType
@@ -328,6 +524,49 @@ func SplitStorageSpaceID(ssid string) (storageid, nodeid string, err error) {
 	return parts[0], parts[1], nil
 }
 
+// SameSpace returns whether the two storage space ids refer to the same space.
+// A bare storage id is treated as `<storageid>!<storageid>`, so "1234"
+// and "1234!1234" refer to the same space.
+func SameSpace(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	as, an := normalizeStorageSpaceID(a)
+	bs, bn := normalizeStorageSpaceID(b)
+	return as == bs && an == bn
+}
+
+func normalizeStorageSpaceID(ssid string) (storageid, nodeid string) {
+	storageid, nodeid, err := SplitStorageSpaceID(ssid)
+	if err != nil {
+		return ssid, ssid
+	}
+	return storageid, nodeid
+}
+
+// ParseResourceID parses a resource id in the form `<storageid>!<opaqueid>`
+// or `<storageid>$<spaceid>!<opaqueid>`. All the components must be non empty.
+// Like SplitStorageSpaceID it splits on the first `!`, so the opaque id may
+// contain further `!`.
+func ParseResourceID(s string) (*provider.ResourceId, error) {
+	storage, opaque, err := SplitStorageSpaceID(s)
+	if err != nil {
+		return nil, errtypes.BadRequest("invalid resource id: " + err.Error())
+	}
+	storageid, spaceid, hasSpace := strings.Cut(storage, "$")
+	if storageid == "" || opaque == "" || (hasSpace && spaceid == "") {
+		return nil, errtypes.BadRequest("invalid resource id: empty component in " + s)
+	}
+	if strings.Contains(spaceid, "$") {
+		return nil, errtypes.BadRequest("invalid resource id: too many delimiters in " + s)
+	}
+	return &provider.ResourceId{
+		StorageId: storageid,
+		SpaceId:   spaceid,
+		OpaqueId:  opaque,
+	}, nil
+}
+
 // ParseStorageSpaceReference parses a string into a spaces reference.
 // The expected format is `<storageid>!<nodeid>/<path>`.
 func ParseStorageSpaceReference(sRef string) (provider.Reference, error) {
@@ -352,6 +591,19 @@ func ParseStorageSpaceReference(sRef string) (provider.Reference, error) {
 	}, nil
 }
 
+// MergeOpaque returns a new opaque containing the entries of dst and src.
+// Entries in src override the ones in dst with the same key.
+// Nil inputs are treated as empty and the inputs are never modified.
+func MergeOpaque(dst, src *types.Opaque) *types.Opaque {
+	m := make(map[string]*types.OpaqueEntry, len(dst.GetMap())+len(src.GetMap()))
+	for _, o := range []*types.Opaque{dst, src} {
+		for k, v := range o.GetMap() {
+			m[k] = proto.Clone(v).(*types.OpaqueEntry)
+		}
+	}
+	return &types.Opaque{Map: m}
+}
+
 // GetViewMode converts a human-readable string to a view mode for opening a resource in an app.
 func GetViewMode(viewMode string) gateway.OpenInAppRequest_ViewMode {
 	switch viewMode {
@@ -430,6 +682,32 @@ func UserIsLightweight(u *userpb.User) bool {
 		u.Id.Type == userpb.UserType_USER_TYPE_LIGHTWEIGHT
 }
 
+// RedactUser returns a copy of the user suitable for logging, where the
+// mail and the display name are masked. Ids are preserved and the given
+// user is not modified.
+func RedactUser(u *userpb.User) *userpb.User {
+	if u == nil {
+		return nil
+	}
+	r := proto.Clone(u).(*userpb.User)
+	r.DisplayName = mask(r.DisplayName)
+	if local, domain, ok := strings.Cut(r.Mail, "@"); ok {
+		r.Mail = mask(local) + "@" + domain
+	} else {
+		r.Mail = mask(r.Mail)
+	}
+	return r
+}
+
+// mask keeps the first character of s and replaces the rest with ***.
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	return string(first) + "***"
+}
+
 // Cast casts a value `v` to the value `to`.
 // `v` is expected to be the underlying type of `to`.
 // For example, if the type A is defined as func()
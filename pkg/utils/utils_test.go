@@ -19,9 +19,12 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 )
 
 var skipTests = []struct {
@@ -46,6 +49,60 @@ func TestSkip(t *testing.T) {
 		})
 	}
 }
+
+var skipFoldTests = []struct {
+	name string
+	url  string
+	base []string
+	out  bool
+}{
+	{"valid subpath", "/a/b/c/d", []string{"/a/b/"}, true},
+	{"valid subpath different case", "/A/b/C/d", []string{"/a/B/c"}, true},
+	{"invalid subpath", "/a/b/c", []string{"/a/b/c/d"}, false},
+	{"equal values different case", "/a/b/c", []string{"/A/B/C"}, true},
+	{"partial segment", "/a/bc", []string{"/A/B"}, false},
+	{"second prefix matches", "/x/y", []string{"/a", "/X"}, true},
+	{"no prefixes", "/a/b/c", nil, false},
+}
+
+func TestSkipFold(t *testing.T) {
+	for _, tt := range skipFoldTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := SkipFold(tt.url, tt.base)
+			if r != tt.out {
+				t.Errorf("expected %v, want %v", r, tt.out)
+			}
+		})
+	}
+}
+
+var hasAnySuffixTests = []struct {
+	name     string
+	source   string
+	suffixes []string
+	out      bool
+}{
+	{"matching extension", "/a/b/file.txt", []string{".txt"}, true},
+	{"second suffix matches", "/a/b/file.md", []string{".txt", ".md"}, true},
+	{"no match", "/a/b/file.txt", []string{".md", ".pdf"}, false},
+	{"case sensitive", "/a/b/file.TXT", []string{".txt"}, false},
+	{"empty suffix is ignored", "/a/b/file.txt", []string{""}, false},
+	{"no suffixes", "/a/b/file.txt", nil, false},
+}
+
+func TestHasAnySuffix(t *testing.T) {
+	for _, tt := range hasAnySuffixTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := HasAnySuffix(tt.source, tt.suffixes)
+			if r != tt.out {
+				t.Errorf("expected %v, want %v", r, tt.out)
+			}
+		})
+	}
+}
+
 func TestIsRelativeReference(t *testing.T) {
 	tests := []struct {
 		ref      *provider.Reference
@@ -276,3 +333,550 @@ func TestHasPermissions(t *testing.T) {
 		})
 	}
 }
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		err      bool
+	}{
+		{"empty", "", "/", false},
+		{"root", "/", "/", false},
+		{"already clean", "/a/b/c", "/a/b/c", false},
+		{"relative", "a/b", "/a/b", false},
+		{"double slashes", "//a//b///c", "/a/b/c", false},
+		{"trailing slash", "/a/b/", "/a/b", false},
+		{"dot segments", "/a/./b/.", "/a/b", false},
+		{"parent within root", "/a/b/../c", "/a/c", false},
+		{"back to root", "/a/..", "/", false},
+		{"traversal", "..", "", true},
+		{"absolute traversal", "/../etc/passwd", "", true},
+		{"nested traversal", "/a/../../etc", "", true},
+		{"relative traversal", "a/b/../../../c", "", true},
+		{"traversal with double slashes", "//..//..//etc", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := CleanPath(tt.path)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error for path %q, got %q", tt.path, res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for path %q: %v", tt.path, err)
+			}
+			if res != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestContainsResourceID(t *testing.T) {
+	full := &provider.ResourceId{StorageId: "storageId", OpaqueId: "opaqueId"}
+	storageOnly := &provider.ResourceId{StorageId: "storageId"}
+
+	tests := []struct {
+		name     string
+		ids      []*provider.ResourceId
+		id       *provider.ResourceId
+		expected bool
+	}{
+		{"empty list", nil, full, false},
+		{"nil id", []*provider.ResourceId{full, nil}, nil, false},
+		{"same pointer", []*provider.ResourceId{full}, full, true},
+		{"equal values", []*provider.ResourceId{nil, {StorageId: "storageId", OpaqueId: "opaqueId"}}, full, true},
+		{"storage id only", []*provider.ResourceId{full}, storageOnly, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := ContainsResourceID(tt.ids, tt.id); res != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestDedupResourceIDs(t *testing.T) {
+	a := &provider.ResourceId{StorageId: "storageId", OpaqueId: "a"}
+	b := &provider.ResourceId{StorageId: "storageId", OpaqueId: "b"}
+	storageOnly := &provider.ResourceId{StorageId: "storageId"}
+
+	tests := []struct {
+		name     string
+		ids      []*provider.ResourceId
+		expected []*provider.ResourceId
+	}{
+		{"nil slice", nil, []*provider.ResourceId{}},
+		{"no duplicates", []*provider.ResourceId{a, b}, []*provider.ResourceId{a, b}},
+		{
+			"duplicates keep first seen order",
+			[]*provider.ResourceId{b, a, {StorageId: "storageId", OpaqueId: "b"}, a},
+			[]*provider.ResourceId{b, a},
+		},
+		{"nil entries", []*provider.ResourceId{nil, a, nil}, []*provider.ResourceId{a}},
+		{
+			"storage id only and full ids",
+			[]*provider.ResourceId{storageOnly, a, {StorageId: "storageId"}},
+			[]*provider.ResourceId{storageOnly, a},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := DedupResourceIDs(tt.ids)
+			if len(res) != len(tt.expected) {
+				t.Fatalf("expected %d ids, got %d: %v", len(tt.expected), len(res), res)
+			}
+			for i := range res {
+				if !ResourceIDEqual(res[i], tt.expected[i]) {
+					t.Errorf("position %d: expected %v, got %v", i, tt.expected[i], res[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPathReference(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"folder", "/folder"},
+		{"/folder//file", "/folder/file"},
+		{"/folder/../folder2/", "/folder2"},
+		{"folder/../../folder2", ""},
+		{"../../etc", ""},
+	}
+	for _, tt := range tests {
+		ref := PathReference(tt.path)
+		if tt.expected == "" {
+			if ref != nil {
+				t.Errorf("PathReference(%q): expected nil for a path escaping the root, got %v", tt.path, ref)
+			}
+			continue
+		}
+		if ref == nil {
+			t.Fatalf("PathReference(%q): expected reference, got nil", tt.path)
+		}
+		if ref.Path != tt.expected {
+			t.Errorf("PathReference(%q): expected path %s, got %s", tt.path, tt.expected, ref.Path)
+		}
+		if !IsAbsolutePathReference(ref) {
+			t.Errorf("PathReference(%q): expected absolute path reference, got %v", tt.path, ref)
+		}
+	}
+
+	if ref := PathReference(""); ref != nil {
+		t.Errorf("PathReference(\"\"): expected nil, got %v", ref)
+	}
+}
+
+func TestRelativePathReference(t *testing.T) {
+	id := &provider.ResourceId{StorageId: "storageId", OpaqueId: "opaqueId"}
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "."},
+		{"folder", "./folder"},
+		{"/folder/file", "./folder/file"},
+		{"/folder/../folder2", "./folder2"},
+	}
+	for _, tt := range tests {
+		ref := RelativePathReference(id, tt.path)
+		if ref == nil {
+			t.Fatalf("RelativePathReference(%q): expected reference, got nil", tt.path)
+		}
+		if ref.Path != tt.expected {
+			t.Errorf("RelativePathReference(%q): expected path %s, got %s", tt.path, tt.expected, ref.Path)
+		}
+		if !ResourceIDEqual(ref.ResourceId, id) {
+			t.Errorf("RelativePathReference(%q): expected resource id %v, got %v", tt.path, id, ref.ResourceId)
+		}
+		if !IsRelativeReference(ref) {
+			t.Errorf("RelativePathReference(%q): expected relative reference, got %v", tt.path, ref)
+		}
+	}
+
+	if ref := RelativePathReference(id, ""); ref != nil {
+		t.Errorf("RelativePathReference with empty path: expected nil, got %v", ref)
+	}
+	if ref := RelativePathReference(nil, "folder"); ref != nil {
+		t.Errorf("RelativePathReference with nil id: expected nil, got %v", ref)
+	}
+	for _, p := range []string{"../../etc", "./../etc", "folder/../../etc"} {
+		if ref := RelativePathReference(id, p); ref != nil {
+			t.Errorf("RelativePathReference(%q): expected nil for a path escaping the root, got %v", p, ref)
+		}
+	}
+}
+
+func TestIsEmailValid(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected bool
+	}{
+		{"einstein@example.org", true},
+		{"marie.curie@cern.ch", true},
+		{"first.middle.last@sub.domain.example.com", true},
+		{"user_name-1@example-domain.org", true},
+		{"curator@natural.history.museum", true},
+		{"dev@company.software", true},
+		{"einstein+reva@example.org", true},
+		{"einstein+tag+other@example.org", true},
+		{"a@b.co", true},
+		{"", false},
+		{"a@", false},
+		{"plainaddress", false},
+		{"@example.org", false},
+		{"einstein@", false},
+		{"einstein@example", false},
+		{"einstein@example.c", false},
+		{"einstein@example.c0m", false},
+		{"einstein@@example.org", false},
+		{"ein stein@example.org", false},
+		{".einstein@example.org", false},
+		{"einstein.@example.org", false},
+		{"ein..stein@example.org", false},
+		{"einstein@.example.org", false},
+		{"einstein@example..org", false},
+		{"einstein@example.org.", false},
+		{strings.Repeat("a", 250) + "@example.org", false},
+	}
+
+	for _, tt := range tests {
+		if res := IsEmailValid(tt.email); res != tt.expected {
+			t.Errorf("IsEmailValid(%q): expected %t, got %t", tt.email, tt.expected, res)
+		}
+	}
+}
+
+func TestParseResourceID(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		expected *provider.ResourceId
+	}{
+		{"storage and opaque id", "1234!abcd", &provider.ResourceId{StorageId: "1234", OpaqueId: "abcd"}},
+		{"storage, space and opaque id", "1234$5678!abcd", &provider.ResourceId{StorageId: "1234", SpaceId: "5678", OpaqueId: "abcd"}},
+		{"opaque id with special chars", "1234!fileid-%2Fhome%2Ffile", &provider.ResourceId{StorageId: "1234", OpaqueId: "fileid-%2Fhome%2Ffile"}},
+		{"empty", "", nil},
+		{"no delimiter", "1234abcd", nil},
+		{"empty storage id", "!abcd", nil},
+		{"empty opaque id", "1234!", nil},
+		{"empty space id", "1234$!abcd", nil},
+		{"only space delimiter", "$5678!abcd", nil},
+		{"opaque id with delimiter", "1234!abcd!efgh", &provider.ResourceId{StorageId: "1234", OpaqueId: "abcd!efgh"}},
+		{"too many space delimiters", "1234$5678$9!abcd", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ParseResourceID(tt.id)
+			if tt.expected == nil {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %v", tt.id, id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.id, err)
+			}
+			if id.StorageId != tt.expected.StorageId || id.SpaceId != tt.expected.SpaceId || id.OpaqueId != tt.expected.OpaqueId {
+				t.Errorf("expected %v, got %v", tt.expected, id)
+			}
+		})
+	}
+}
+
+func TestMergeOpaque(t *testing.T) {
+	entry := func(v string) *types.OpaqueEntry {
+		return &types.OpaqueEntry{Decoder: "plain", Value: []byte(v)}
+	}
+
+	tests := []struct {
+		name     string
+		dst      *types.Opaque
+		src      *types.Opaque
+		expected map[string]string
+	}{
+		{
+			name:     "both nil",
+			expected: map[string]string{},
+		},
+		{
+			name:     "nil dst",
+			src:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"a": entry("1")}},
+			expected: map[string]string{"a": "1"},
+		},
+		{
+			name:     "nil src",
+			dst:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"a": entry("1")}},
+			expected: map[string]string{"a": "1"},
+		},
+		{
+			name:     "nil map",
+			dst:      &types.Opaque{},
+			src:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"a": entry("1")}},
+			expected: map[string]string{"a": "1"},
+		},
+		{
+			name:     "disjoint keys",
+			dst:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"a": entry("1")}},
+			src:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"b": entry("2")}},
+			expected: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:     "src overrides dst",
+			dst:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"a": entry("1"), "b": entry("2")}},
+			src:      &types.Opaque{Map: map[string]*types.OpaqueEntry{"b": entry("3")}},
+			expected: map[string]string{"a": "1", "b": "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstLen, srcLen := len(tt.dst.GetMap()), len(tt.src.GetMap())
+
+			res := MergeOpaque(tt.dst, tt.src)
+			if len(res.Map) != len(tt.expected) {
+				t.Fatalf("expected %d entries, got %d: %v", len(tt.expected), len(res.Map), res.Map)
+			}
+			for k, v := range tt.expected {
+				if e, ok := res.Map[k]; !ok || string(e.Value) != v || e.Decoder != "plain" {
+					t.Errorf("key %s: expected %s, got %v", k, v, e)
+				}
+			}
+
+			// the inputs must not be modified
+			if len(tt.dst.GetMap()) != dstLen || len(tt.src.GetMap()) != srcLen {
+				t.Errorf("inputs were modified")
+			}
+			for k, e := range res.Map {
+				e.Value = []byte("changed")
+				if d, ok := tt.dst.GetMap()[k]; ok && string(d.Value) == "changed" {
+					t.Errorf("key %s: dst entry shared with the result", k)
+				}
+				if s, ok := tt.src.GetMap()[k]; ok && string(s.Value) == "changed" {
+					t.Errorf("key %s: src entry shared with the result", k)
+				}
+			}
+		})
+	}
+}
+
+func TestGetReferenceKind(t *testing.T) {
+	id := &provider.ResourceId{StorageId: "storageId", OpaqueId: "opaqueId"}
+	tests := []struct {
+		name     string
+		ref      *provider.Reference
+		expected ReferenceKind
+	}{
+		{"nil reference", nil, ReferenceKindInvalid},
+		{"empty reference", &provider.Reference{}, ReferenceKindInvalid},
+		{"relative path without id", &provider.Reference{Path: "."}, ReferenceKindInvalid},
+		{"path without prefix", &provider.Reference{Path: "folder"}, ReferenceKindInvalid},
+		{"id with absolute path", &provider.Reference{ResourceId: id, Path: "/folder"}, ReferenceKindInvalid},
+		{"id with path without prefix", &provider.Reference{ResourceId: id, Path: "folder"}, ReferenceKindInvalid},
+		{"relative", &provider.Reference{ResourceId: id, Path: "./folder"}, ReferenceKindRelative},
+		{"relative to the id", &provider.Reference{ResourceId: id, Path: "."}, ReferenceKindRelative},
+		{"relative with empty id", &provider.Reference{ResourceId: &provider.ResourceId{}, Path: "./folder"}, ReferenceKindRelative},
+		{"absolute id", &provider.Reference{ResourceId: id}, ReferenceKindAbsoluteID},
+		{"absolute empty id", &provider.Reference{ResourceId: &provider.ResourceId{}}, ReferenceKindAbsoluteID},
+		{"absolute path", &provider.Reference{Path: "/folder"}, ReferenceKindAbsolutePath},
+		{"root path", &provider.Reference{Path: "/"}, ReferenceKindAbsolutePath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := GetReferenceKind(tt.ref); kind != tt.expected {
+				t.Errorf("expected kind %d, got %d", tt.expected, kind)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		expected string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"spaces", "my report.pdf", "my report.pdf"},
+		{"unicode", "résumé 履歴書.txt", "résumé 履歴書.txt"},
+		{"quotes", `say "hi".txt`, "say _hi_.txt"},
+		{"backslash", `a\b.txt`, "a_b.txt"},
+		{"slash", "a/b.txt", "a_b.txt"},
+		{"crlf injection", "file.txt\r\nSet-Cookie: x=y", "file.txtSet-Cookie: x=y"},
+		{"header break with quote", "file.txt\"\r\nX-Evil: 1", "file.txt_X-Evil: 1"},
+		{"tab and null", "a\tb\x00c.txt", "abc.txt"},
+		{"invalid utf8", "a\xffb.txt", "ab.txt"},
+		{"surrounding spaces", "  file.txt  ", "file.txt"},
+		{"empty", "", "download"},
+		{"only control chars", "\r\n\t", "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := SanitizeFilename(tt.filename); res != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestSameSpace(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"1234", "1234", true},
+		{"1234!abcd", "1234!abcd", true},
+		{"1234", "1234!1234", true},
+		{"1234!1234", "1234", true},
+		{"1234", "1234!abcd", false},
+		{"1234!abcd", "1234!efgh", false},
+		{"1234!abcd", "5678!abcd", false},
+		{"1234", "5678", false},
+		{"", "", false},
+		{"1234", "", false},
+	}
+
+	for _, tt := range tests {
+		if res := SameSpace(tt.a, tt.b); res != tt.expected {
+			t.Errorf("SameSpace(%q, %q): expected %t, got %t", tt.a, tt.b, tt.expected, res)
+		}
+	}
+}
+
+func TestBuildEtag(t *testing.T) {
+	etag := BuildEtag("id", "1700000000", "42")
+	if len(etag) != 34 {
+		t.Errorf("expected etag of 34 characters, got %d: %s", len(etag), etag)
+	}
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		t.Errorf("expected quoted etag, got %s", etag)
+	}
+	if BuildEtag("id", "1700000000", "42") != etag {
+		t.Errorf("expected the same parts to produce the same etag")
+	}
+
+	different := [][]string{
+		{"42", "1700000000", "id"},
+		{"id", "1700000001", "42"},
+		{"id1700000000", "42"},
+		{"id", "1700000000", "42", ""},
+	}
+	for _, parts := range different {
+		if e := BuildEtag(parts...); e == etag {
+			t.Errorf("expected parts %v to produce a different etag", parts)
+		}
+	}
+
+	if len(BuildEtag()) != 34 {
+		t.Errorf("expected etag of 34 characters without parts")
+	}
+}
+
+func TestRelativePathBetween(t *testing.T) {
+	id := &provider.ResourceId{StorageId: "storageId", OpaqueId: "opaqueId"}
+	other := &provider.ResourceId{StorageId: "storageId", OpaqueId: "otherId"}
+
+	tests := []struct {
+		name       string
+		ancestor   *provider.Reference
+		descendant *provider.Reference
+		expected   string
+		err        bool
+	}{
+		{"global paths", &provider.Reference{Path: "/a"}, &provider.Reference{Path: "/a/b/c"}, "b/c", false},
+		{"global root", &provider.Reference{Path: "/"}, &provider.Reference{Path: "/a/b"}, "a/b", false},
+		{"same global path", &provider.Reference{Path: "/a/b/"}, &provider.Reference{Path: "/a/b"}, ".", false},
+		{"relative paths", &provider.Reference{ResourceId: id, Path: "./a"}, &provider.Reference{ResourceId: id, Path: "./a/b"}, "b", false},
+		{"relative to the id", &provider.Reference{ResourceId: id}, &provider.Reference{ResourceId: id, Path: "./a/b"}, "a/b", false},
+		{"same resource", &provider.Reference{ResourceId: id, Path: "."}, &provider.Reference{ResourceId: id}, ".", false},
+		{"sibling", &provider.Reference{Path: "/a/b"}, &provider.Reference{Path: "/a/c"}, "", true},
+		{"common name prefix", &provider.Reference{Path: "/a/b"}, &provider.Reference{Path: "/a/bc"}, "", true},
+		{"descendant above ancestor", &provider.Reference{Path: "/a/b"}, &provider.Reference{Path: "/a"}, "", true},
+		{"different ids", &provider.Reference{ResourceId: id}, &provider.Reference{ResourceId: other, Path: "./a"}, "", true},
+		{"id and global path", &provider.Reference{ResourceId: id}, &provider.Reference{Path: "/a"}, "", true},
+		{"nil reference", nil, &provider.Reference{Path: "/a"}, "", true},
+		{"descendant escaping the root", &provider.Reference{ResourceId: id}, &provider.Reference{ResourceId: id, Path: "./../x"}, "", true},
+		{"ancestor escaping the root", &provider.Reference{Path: "/../a"}, &provider.Reference{Path: "/a/b"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := RelativePathBetween(tt.ancestor, tt.descendant)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %q", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestRedactUser(t *testing.T) {
+	if RedactUser(nil) != nil {
+		t.Errorf("expected nil for a nil user")
+	}
+
+	u := &userpb.User{
+		Id:          &userpb.UserId{Idp: "idp", OpaqueId: "einstein", Type: userpb.UserType_USER_TYPE_PRIMARY},
+		Username:    "einstein",
+		Mail:        "albert.einstein@example.org",
+		DisplayName: "Albert Einstein",
+		UidNumber:   1000,
+		GidNumber:   100,
+	}
+
+	r := RedactUser(u)
+	if r.Mail != "a***@example.org" {
+		t.Errorf("expected masked mail, got %s", r.Mail)
+	}
+	if r.DisplayName != "A***" {
+		t.Errorf("expected masked display name, got %s", r.DisplayName)
+	}
+	if !UserEqual(r.Id, u.Id) || r.Id.Type != u.Id.Type || r.Username != u.Username || r.UidNumber != u.UidNumber || r.GidNumber != u.GidNumber {
+		t.Errorf("expected ids to be preserved, got %+v", r)
+	}
+
+	// the original user must not be modified
+	if u.Mail != "albert.einstein@example.org" || u.DisplayName != "Albert Einstein" {
+		t.Errorf("original user was modified: %+v", u)
+	}
+	r.Id.OpaqueId = "changed"
+	if u.Id.OpaqueId != "einstein" {
+		t.Errorf("redacted user shares its id with the original")
+	}
+
+	tests := []struct {
+		mail, displayName       string
+		expMail, expDisplayName string
+	}{
+		{"", "", "", ""},
+		{"not-an-email", "Émilie", "n***", "É***"},
+	}
+	for _, tt := range tests {
+		r := RedactUser(&userpb.User{Mail: tt.mail, DisplayName: tt.displayName})
+		if r.Mail != tt.expMail || r.DisplayName != tt.expDisplayName {
+			t.Errorf("expected mail %q and display name %q, got %q and %q", tt.expMail, tt.expDisplayName, r.Mail, r.DisplayName)
+		}
+	}
+}